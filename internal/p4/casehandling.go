@@ -0,0 +1,81 @@
+package p4
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/danbrakeley/bs"
+)
+
+// CaseSensitivity describes how a Perforce server compares depot file paths when deciding
+// whether two paths refer to the same file.
+type CaseSensitivity int
+
+const (
+	// CaseSensitive means the server treats paths that differ only by case as distinct files.
+	// This is the default for servers hosted on Unix-like filesystems.
+	CaseSensitive CaseSensitivity = iota
+	// CaseInsensitive means the server treats paths that differ only by case as the same file.
+	// This is the default for servers hosted on Windows.
+	CaseInsensitive
+)
+
+// CaseHandling returns the depot server's configured case-sensitivity, as reported by the
+// "Case Handling" field of `p4 info`. The value is cached on first call, alongside StreamDepth,
+// since it cannot change for the lifetime of a P4 connection.
+func (p *P4) CaseHandling() (CaseSensitivity, error) {
+	if p.caseHandling != nil {
+		return *p.caseHandling, nil
+	}
+
+	var buf bytes.Buffer
+	if err := bs.Cmd("p4 info").Out(&buf).RunErr(); err != nil {
+		return 0, fmt.Errorf(`error running "p4 info": %w`, err)
+	}
+
+	ch, err := parseCaseHandling(buf.String())
+	if err != nil {
+		return 0, err
+	}
+
+	p.caseHandling = &ch
+	return ch, nil
+}
+
+// CheckCaseCollisions scans files, which must already be sorted case-insensitively by Path (see
+// DepotFileByPath), for two or more distinct paths that differ only by case. It returns an error
+// naming the first pair found. This guards against silently merging legitimately distinct files
+// (eg. "Foo.txt" and "foo.txt") when harmonizing a case-sensitive source against a
+// case-insensitive destination, or vice-versa.
+func CheckCaseCollisions(files []DepotFile) error {
+	for i := 1; i < len(files); i++ {
+		a, b := files[i-1].Path, files[i].Path
+		if a != b && strings.EqualFold(a, b) {
+			return fmt.Errorf(`depot paths %q and %q differ only by case`, a, b)
+		}
+	}
+	return nil
+}
+
+// parseCaseHandling extracts the server's case-sensitivity from the text output of `p4 info`.
+func parseCaseHandling(info string) (CaseSensitivity, error) {
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		rest, ok := strings.CutPrefix(line, "Case Handling:")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(rest) {
+		case "sensitive":
+			return CaseSensitive, nil
+		case "insensitive":
+			return CaseInsensitive, nil
+		default:
+			return 0, fmt.Errorf(`unrecognized "Case Handling" value: %s`, rest)
+		}
+	}
+
+	return 0, fmt.Errorf(`"Case Handling" field not found in "p4 info" output`)
+}
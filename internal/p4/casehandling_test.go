@@ -0,0 +1,118 @@
+package p4
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParseCaseHandling(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    string
+		want    CaseSensitivity
+		wantErr bool
+	}{
+		{
+			name: "sensitive",
+			info: `User name: alice
+Client name: alice_ws
+Client host: alice-pc
+Client root: /home/alice/depot
+Current directory: /home/alice/depot
+Client address: 127.0.0.1
+Server address: perforce.example.com:1666
+Server root: /p4/1
+Server date: 2026/07/29 12:00:00 -0700 PDT
+Server uptime: 10:23:45
+Server version: P4D/LINUX26X86_64/2023.1/2513900 (2023/04/18)
+ServerID: master
+Server services: standard
+Case Handling: sensitive
+`,
+			want: CaseSensitive,
+		},
+		{
+			name: "insensitive",
+			info: `User name: bob
+Client name: bob_ws
+Server address: perforce.example.com:1666
+Server version: P4D/NTX64/2023.1/2513900 (2023/04/18)
+Case Handling: insensitive
+`,
+			want: CaseInsensitive,
+		},
+		{
+			name:    "field missing",
+			info:    "User name: alice\nServer address: perforce.example.com:1666\n",
+			wantErr: true,
+		},
+		{
+			name:    "unrecognized value",
+			info:    "Case Handling: mixed\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCaseHandling(tt.info)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCaseHandling() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCaseHandling() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseCaseHandling() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCaseCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{
+			name:  "no collision",
+			paths: []string{"Foo.txt", "bar.txt"},
+		},
+		{
+			name:    "collision",
+			paths:   []string{"Foo.txt", "foo.txt"},
+			wantErr: true,
+		},
+		{
+			name:  "exact duplicate is not a collision",
+			paths: []string{"foo.txt", "foo.txt"},
+		},
+		{
+			name:    "collision not adjacent under case-sensitive sort order",
+			paths:   []string{"Foo.txt", "bar.txt", "foo.txt"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make([]DepotFile, len(tt.paths))
+			for i, p := range tt.paths {
+				files[i] = DepotFile{Path: p}
+			}
+			sort.Sort(DepotFileByPath{Files: files, Case: CaseInsensitive})
+
+			err := CheckCaseCollisions(files)
+			if tt.wantErr && err == nil {
+				t.Fatalf("CheckCaseCollisions() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("CheckCaseCollisions() unexpected error: %v", err)
+			}
+		})
+	}
+}
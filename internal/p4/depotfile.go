@@ -5,23 +5,42 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/danbrakeley/bs"
 )
 
 type DepotFile struct {
-	Path   string // relative to depot, ie 'Engine/foo', not '//UE4/Release/Engine/foo'
-	Action string
-	CL     string
-	Type   string
+	Path     string // relative to depot, ie 'Engine/foo', not '//UE4/Release/Engine/foo'
+	Action   string
+	CL       string
+	Type     string
+	Digest   string // MD5 digest of the file's content, only populated by FstatFiles
+	FileSize int64  // only populated by FstatFiles
+	HeadRev  string // only populated by FstatFiles
+	HeadTime string // only populated by FstatFiles
 }
 
-// runAndParseDepotFiles calls the given command, which is expected to return a list of records, each
-// with at least a depotFile, and optionally also a type, change, and action.
-// The results are then sorted by Path (case-insensitive) and returned.
-func (p *P4) runAndParseDepotFiles(cmd string) ([]DepotFile, error) {
+// DepotFileResult wraps a single DepotFile record streamed from StreamDepotFiles, along with any
+// error encountered while producing it. A non-nil Err is always the last value sent on the channel.
+type DepotFileResult struct {
+	File DepotFile
+	Err  error
+}
+
+// StreamDepotFiles calls the given command, which is expected to return a list of records, each
+// with at least a depotFile, and optionally also a type, change, and action. Records are parsed
+// and emitted on the returned channel as they complete, so callers can process huge depots in
+// constant memory instead of waiting for the entire result set to buffer. The channel is closed
+// once the command's output is fully consumed; any error running the command or scanning its
+// output is delivered as a final DepotFileResult with Err set.
+//
+// If the caller stops ranging over the channel before it's closed (eg. it found what it was
+// looking for), it must close done to let the producer goroutine know to stop sending and exit,
+// rather than blocking forever on a send no one will receive. Pass nil if the caller always
+// drains the channel to completion.
+func (p *P4) StreamDepotFiles(cmd string, done <-chan struct{}) (<-chan DepotFileResult, error) {
 	if !strings.Contains(cmd, "-ztag") && !strings.Contains(cmd, "-z tag") {
 		return nil, fmt.Errorf(`missing "-z tag" in cmd: %s`, cmd)
 	}
@@ -31,68 +50,151 @@ func (p *P4) runAndParseDepotFiles(cmd string) ([]DepotFile, error) {
 		return nil, err
 	}
 
-	var errCmd error
 	r, w := io.Pipe()
-	var wg sync.WaitGroup
-	wg.Add(1)
 	go func() {
-		errCmd = bs.Cmd(cmd).Out(w).RunErr()
-		w.Close()
-		wg.Done()
+		errCmd := bs.Cmd(cmd).Out(w).RunErr()
+		w.CloseWithError(errCmd)
 	}()
 
-	out := make([]DepotFile, 0, 1024*1024)
-	var cur DepotFile
-	var prefix string
-	s := bufio.NewScanner(r)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		// p4 -ztag uses an empty line to indicate the end of a record
-		if len(line) == 0 {
-			if len(cur.Path) != 0 {
-				out = append(out, cur)
+	return streamDepotFileRecords(r, streamDepth, done), nil
+}
+
+// streamDepotFileRecords scans r for p4 -ztag output and emits each completed record on the
+// returned channel as it completes, so huge depots can be processed in constant memory. It is the
+// guts of StreamDepotFiles, split out so it can be driven by a test-controlled pipe instead of a
+// live p4 command. See StreamDepotFiles for the contract around done and the channel's errors.
+func streamDepotFileRecords(r *io.PipeReader, streamDepth int, done <-chan struct{}) <-chan DepotFileResult {
+	out := make(chan DepotFileResult)
+	go func() {
+		defer close(out)
+		defer r.Close()
+
+		// send delivers res on out, unless done fires first, in which case it stops the
+		// caller's in-flight p4 command and scan by closing the pipe's read side.
+		// done is checked before attempting the send, so a closed done always wins over a
+		// receiver that happens to still be waiting on out.
+		send := func(res DepotFileResult) bool {
+			select {
+			case <-done:
+				return false
+			default:
+			}
+			select {
+			case out <- res:
+				return true
+			case <-done:
+				return false
 			}
-			cur = DepotFile{}
-			continue
 		}
-		// otherwise, parse the fields
-		switch {
-		case len(line) < 5 || !strings.HasPrefix(line, "... "):
-			r.CloseWithError(fmt.Errorf(`expected "... <tag>", but got: %s`, line))
-		case strings.HasPrefix(line[4:], "depotFile"):
-			raw := strings.TrimSpace(line[14:])
-			if len(prefix) == 0 {
-				var err error
-				prefix, err = getDepotPrefix(raw, streamDepth)
+
+		var cur DepotFile
+		var prefix string
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			// p4 -ztag uses an empty line to indicate the end of a record
+			if len(line) == 0 {
+				if len(cur.Path) != 0 {
+					if !send(DepotFileResult{File: cur}) {
+						return
+					}
+				}
+				cur = DepotFile{}
+				continue
+			}
+			// otherwise, parse the fields
+			switch {
+			case len(line) < 5 || !strings.HasPrefix(line, "... "):
+				r.CloseWithError(fmt.Errorf(`expected "... <tag>", but got: %s`, line))
+			case strings.HasPrefix(line[4:], "depotFile"):
+				raw := strings.TrimSpace(line[14:])
+				if len(prefix) == 0 {
+					var err error
+					prefix, err = getDepotPrefix(raw, streamDepth)
+					if err != nil {
+						r.CloseWithError(fmt.Errorf(`error parsing depot prefix: %w`, err))
+						break
+					}
+				}
+				cur.Path = strings.TrimPrefix(raw, prefix)
+			case strings.HasPrefix(line[4:], "action"):
+				cur.Action = strings.TrimSpace(line[10:])
+			case strings.HasPrefix(line[4:], "change"):
+				cur.CL = strings.TrimSpace(line[10:])
+			case strings.HasPrefix(line[4:], "type"):
+				cur.Type = strings.TrimSpace(line[8:])
+			case strings.HasPrefix(line[4:], "digest"):
+				cur.Digest = strings.TrimSpace(line[10:])
+			case strings.HasPrefix(line[4:], "fileSize"):
+				v := strings.TrimSpace(line[12:])
+				size, err := strconv.ParseInt(v, 10, 64)
 				if err != nil {
-					r.CloseWithError(fmt.Errorf(`error parsing depot prefix: %w`, err))
+					r.CloseWithError(fmt.Errorf(`error parsing fileSize %q: %w`, v, err))
 					break
 				}
+				cur.FileSize = size
+			case strings.HasPrefix(line[4:], "headRev"):
+				cur.HeadRev = strings.TrimSpace(line[11:])
+			case strings.HasPrefix(line[4:], "headTime"):
+				cur.HeadTime = strings.TrimSpace(line[12:])
 			}
-			cur.Path = strings.TrimPrefix(raw, prefix)
-		case strings.HasPrefix(line[4:], "action"):
-			cur.Action = strings.TrimSpace(line[10:])
-		case strings.HasPrefix(line[4:], "change"):
-			cur.CL = strings.TrimSpace(line[10:])
-		case strings.HasPrefix(line[4:], "type"):
-			cur.Type = strings.TrimSpace(line[8:])
 		}
+		// if the reader had an error, the scanner will stop scanning and return it here
+		if err := s.Err(); err != nil {
+			send(DepotFileResult{Err: fmt.Errorf(`error scanning for files: %w`, err)})
+		}
+	}()
+
+	return out
+}
+
+// runAndParseDepotFiles calls the given command, which is expected to return a list of records, each
+// with at least a depotFile, and optionally also a type, change, and action.
+// The results are checked for two paths differing only by case (which a case-sensitive server can
+// legitimately list, eg. "Foo.txt" and "foo.txt"), returning an error rather than letting the
+// caller silently merge them, then sorted by Path, using the server's configured case-handling,
+// and returned.
+func (p *P4) runAndParseDepotFiles(cmd string) ([]DepotFile, error) {
+	caseHandling, err := p.CaseHandling()
+	if err != nil {
+		return nil, err
 	}
-	// if the reader had an error, the scanner will stop scanning and return it here
-	if err := s.Err(); err != nil {
-		return nil, fmt.Errorf(`error scanning for files: %w`, err)
+
+	stream, err := p.StreamDepotFiles(cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DepotFile, 0, 1024)
+	for res := range stream {
+		if res.Err != nil {
+			return nil, fmt.Errorf(`error listing files: %w`, res.Err)
+		}
+		out = append(out, res.File)
 	}
 
-	wg.Wait()
-	if errCmd != nil {
-		return nil, fmt.Errorf(`error listing files: %w`, errCmd)
+	// CheckCaseCollisions requires its input sorted case-insensitively, regardless of the
+	// server's actual case-handling, so check against a separate copy rather than `out`.
+	collisionCheck := make([]DepotFile, len(out))
+	copy(collisionCheck, out)
+	sort.Sort(DepotFileByPath{Files: collisionCheck, Case: CaseInsensitive})
+	if err := CheckCaseCollisions(collisionCheck); err != nil {
+		return nil, fmt.Errorf(`error listing files: %w`, err)
 	}
 
-	sort.Sort(DepotFileCaseInsensitive(out))
+	sort.Sort(DepotFileByPath{Files: out, Case: caseHandling})
 
 	return out, nil
 }
 
+// FstatFiles returns the depot files matching pathspec, enriched with Digest, FileSize, HeadRev,
+// and HeadTime. The -Ol flag is what makes the server emit per-file digests, so callers can
+// compare file content directly instead of trusting that a matching (path, type) pair implies
+// matching content.
+func (p *P4) FstatFiles(pathspec string) ([]DepotFile, error) {
+	return p.runAndParseDepotFiles(fmt.Sprintf("p4 -ztag fstat -Ol %s", pathspec))
+}
+
 // getDepotPrefix returns the stream prefix given a line that includes the prefix and the stream depth
 // For example: ("//a/b/c/d:foo", 2) would return "//a/b/"
 func getDepotPrefix(line string, depth int) (string, error) {
@@ -109,11 +211,20 @@ func getDepotPrefix(line string, depth int) (string, error) {
 	return line[:i], nil
 }
 
-// DepotFileCaseInsensitive allows sorting slices of DepotFiles by path, but ignoring case.
-type DepotFileCaseInsensitive []DepotFile
+// DepotFileByPath allows sorting slices of DepotFiles by Path, applying Case to decide whether
+// the comparison should ignore letter case. Case should match the handling of whichever server
+// the files were listed from, as reported by P4.CaseHandling.
+type DepotFileByPath struct {
+	Files []DepotFile
+	Case  CaseSensitivity
+}
 
-func (x DepotFileCaseInsensitive) Len() int { return len(x) }
-func (x DepotFileCaseInsensitive) Less(i, j int) bool {
-	return strings.ToLower(x[i].Path) < strings.ToLower(x[j].Path)
+func (x DepotFileByPath) Len() int      { return len(x.Files) }
+func (x DepotFileByPath) Swap(i, j int) { x.Files[i], x.Files[j] = x.Files[j], x.Files[i] }
+func (x DepotFileByPath) Less(i, j int) bool {
+	a, b := x.Files[i].Path, x.Files[j].Path
+	if x.Case == CaseInsensitive {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return a < b
 }
-func (x DepotFileCaseInsensitive) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
\ No newline at end of file
@@ -0,0 +1,168 @@
+package p4
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamDepotFileRecords_HappyPath(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, "... depotFile //depot/main/foo.txt\n"+
+			"... action edit\n"+
+			"... change 123\n"+
+			"... type text\n"+
+			"\n"+
+			"... depotFile //depot/main/bar.bin\n"+
+			"... action add\n"+
+			"... change 124\n"+
+			"... type binary\n"+
+			"\n")
+		w.Close()
+	}()
+
+	stream := streamDepotFileRecords(r, 2, nil)
+	var got []DepotFile
+	for res := range stream {
+		if res.Err != nil {
+			t.Fatalf("unexpected error: %v", res.Err)
+		}
+		got = append(got, res.File)
+	}
+
+	want := []DepotFile{
+		{Path: "foo.txt", Action: "edit", CL: "123", Type: "text"},
+		{Path: "bar.bin", Action: "add", CL: "124", Type: "binary"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamDepotFileRecords_ScannerError(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, "... depotFile //depot/main/foo.txt\n"+
+			"... action edit\n"+
+			"... change 123\n"+
+			"... type text\n"+
+			"\n")
+		// simulate the p4 command itself failing mid-stream
+		w.CloseWithError(errors.New("simulated p4 failure"))
+	}()
+
+	stream := streamDepotFileRecords(r, 2, nil)
+	var results []DepotFileResult
+	for res := range stream {
+		results = append(results, res)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %+v", len(results), results)
+	}
+	if results[0].Err != nil || results[0].File.Path != "foo.txt" {
+		t.Fatalf("unexpected first result: %+v", results[0])
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "simulated p4 failure") {
+		t.Fatalf("expected trailing error wrapping the simulated failure, got: %v", results[1].Err)
+	}
+}
+
+func TestStreamDepotFileRecords_EarlyCancel(t *testing.T) {
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		io.WriteString(w, "... depotFile //depot/main/foo.txt\n"+
+			"... action edit\n"+
+			"... change 123\n"+
+			"... type text\n"+
+			"\n")
+		// give the test a chance to close done before the next record arrives
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "... depotFile //depot/main/bar.txt\n"+
+			"... action edit\n"+
+			"... change 124\n"+
+			"... type text\n"+
+			"\n")
+		w.Close()
+	}()
+
+	stream := streamDepotFileRecords(r, 2, done)
+	first := <-stream
+	if first.Err != nil || first.File.Path != "foo.txt" {
+		t.Fatalf("unexpected first result: %+v", first)
+	}
+	close(done)
+
+	// the producer goroutine should notice done and exit, closing the channel, rather than
+	// blocking forever trying to send a record no one will receive.
+	select {
+	case v, ok := <-stream:
+		if ok {
+			t.Fatalf("expected channel closed after cancel, got value: %+v", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for producer goroutine to exit after done was closed")
+	}
+}
+
+func TestStreamDepotFileRecords_FstatTags(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, "... depotFile //depot/main/foo.txt\n"+
+			"... action edit\n"+
+			"... change 123\n"+
+			"... type text\n"+
+			"... digest 0123456789ABCDEF0123456789ABCDEF\n"+
+			"... fileSize 42\n"+
+			"... headRev 7\n"+
+			"... headTime 1690000000\n"+
+			// unrelated fstat tags should be ignored rather than erroring
+			"... headAction edit\n"+
+			"... headType text\n"+
+			"\n")
+		w.Close()
+	}()
+
+	stream := streamDepotFileRecords(r, 2, nil)
+	var got []DepotFile
+	for res := range stream {
+		if res.Err != nil {
+			t.Fatalf("unexpected error: %v", res.Err)
+		}
+		got = append(got, res.File)
+	}
+
+	want := DepotFile{
+		Path: "foo.txt", Action: "edit", CL: "123", Type: "text",
+		Digest: "0123456789ABCDEF0123456789ABCDEF", FileSize: 42, HeadRev: "7", HeadTime: "1690000000",
+	}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got %+v, want [%+v]", got, want)
+	}
+}
+
+func TestStreamDepotFileRecords_MalformedFileSize(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		defer w.Close()
+		io.WriteString(w, "... depotFile //depot/main/foo.txt\n"+
+			"... action edit\n"+
+			"... change 123\n"+
+			"... type text\n"+
+			"... fileSize notanumber\n")
+	}()
+
+	stream := streamDepotFileRecords(r, 2, nil)
+	var results []DepotFileResult
+	for res := range stream {
+		results = append(results, res)
+	}
+
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("expected a single error result, got: %+v", results)
+	}
+}